@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os/signal"
+	"syscall"
+
+	"github.com/gorilla/mux"
+	"github.com/jseow5177/tcp-pool/internal/model"
+	"github.com/jseow5177/tcp-pool/internal/tcp"
+	"github.com/jseow5177/tcp-pool/internal/util"
+
+	conf "github.com/jseow5177/tcp-pool/config"
+)
+
+// application mirrors app/http's application, except TcpPool is wired via
+// SetLocal to dispatch straight into this binary's own handlers instead of
+// dialing out, since the TCP server below runs in this same process. This
+// is the HTTP-frontend-and-TCP-backend-in-one-binary case SetLocal exists
+// for; app/http and app/tcp stay as the two-process deployment.
+type application struct {
+	TcpPool *tcp.TcpConnPool
+}
+
+func main() {
+	c := conf.InitConfig()
+
+	// Register a handler for the login_user command
+	tcp.RegisterHandler(&tcp.HandlerConfig{
+		Command: conf.CmdLoginUser,
+		Handler: func(req interface{}, res interface{}) {
+			LoginUser(req.(*model.LoginUserRequest), res.(*model.LoginUserResponse))
+		},
+		Request:  &model.LoginUserRequest{},
+		Response: &model.LoginUserResponse{},
+	})
+
+	// Create tcp connection pool, and point it at DispatchLocalTyped so
+	// CallTyped() skips the socket entirely for this process's own host:port.
+	tcpPool, err := tcp.CreateTcpConnPool(c.TcpConfig)
+	if err != nil {
+		log.Fatalf("fail to connect to TCP server, err: %v", err)
+	}
+	tcpPool.SetLocal(fmt.Sprintf("%s:%d", c.TcpConfig.Host, c.TcpConfig.Port), tcp.DispatchLocalTyped)
+
+	app := &application{
+		TcpPool: tcpPool,
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	go runTcpServer(ctx, c.TcpConfig)
+
+	// Register a handler
+	r := mux.NewRouter()
+	r.HandleFunc("/user/login", app.handleUserLogin).Methods("POST")
+
+	// Start HTTP server
+	log.Printf("http server started at port %d", c.HttpConfig.Port)
+	err = http.ListenAndServe(fmt.Sprintf("%s:%d", c.HttpConfig.Host, c.HttpConfig.Port), r)
+
+	if err != nil {
+		log.Fatalf("error starting http server, err: %v", err)
+	}
+}
+
+// runTcpServer starts the TCP server on its own listener, still reachable
+// over the network for any other client, and shuts down cleanly when ctx
+// is canceled instead of log.Fatalf-ing on a closed listener.
+func runTcpServer(ctx context.Context, cfg *tcp.TcpConfig) {
+	addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("error starting tcp server: %s", err.Error())
+	}
+
+	// Closing the listener is what unblocks Accept() below once ctx is done.
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	log.Printf("tcp server started at port %d", cfg.Port)
+
+	// Accept TCP connections
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				log.Printf("tcp server shutting down")
+				return
+			default:
+				log.Fatalf("tcp server failed to connect, err: %v\n", err)
+			}
+		}
+		go tcp.HandleClientConnection(conn)
+	}
+}
+
+// handleUserLogin() is a HTTP handler for user login
+func (app *application) handleUserLogin(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+
+	// Read user input
+	err := util.ReadJSON(r, &input)
+	if err != nil {
+		util.ServerErrorResponse(w, err)
+		return
+	}
+
+	req := &model.LoginUserRequest{
+		Username: input.Username,
+		Password: input.Password,
+	}
+	res := &model.LoginUserResponse{}
+	// Proxy request to TCP server. Since SetLocal was configured above,
+	// this resolves to a direct call into LoginUser(), not a socket round trip.
+	err = app.sendToTCPServer(r.Context(), conf.CmdLoginUser, tcp.JSONCodecName, req, res)
+	if err != nil {
+		util.ServerErrorResponse(w, err)
+		return
+	}
+
+	// Can create more sophisticated error codes in TCP server
+	// and map the codes back to HTTP codes
+	// I'll skip this approach in this dummy application.
+	status := http.StatusOK
+	if res.ErrCode != 0 {
+		status = http.StatusInternalServerError
+	}
+
+	// Return response back to client
+	util.WriteJSON(w, status, util.Envelope{"msg": res.Message}, nil)
+}
+
+// sendToTCPServer() is a helper method that sends reqData to the TCP server
+// and decodes the response into resDst. ctx is tied to the incoming HTTP
+// request, so a client disconnect aborts the TCP call instead of leaking it.
+func (app *application) sendToTCPServer(ctx context.Context, command string, codec string, reqData interface{}, resDst interface{}) error {
+	return app.TcpPool.CallTyped(ctx, command, codec, reqData, resDst)
+}
+
+func LoginUser(req *model.LoginUserRequest, res *model.LoginUserResponse) {
+	res.Message = "Got it!"
+}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -64,7 +64,7 @@ func (app *application) handleUserLogin(w http.ResponseWriter, r *http.Request)
 	}
 	res := &model.LoginUserResponse{}
 	// Proxy request to TCP server
-	err = app.sendToTCPServer(conf.CmdLoginUser, req, res)
+	err = app.sendToTCPServer(r.Context(), conf.CmdLoginUser, tcp.JSONCodecName, req, res)
 	if err != nil {
 		util.ServerErrorResponse(w, err)
 		return
@@ -83,31 +83,10 @@ func (app *application) handleUserLogin(w http.ResponseWriter, r *http.Request)
 }
 
 // sendToTCPServer() is a helper method that sends reqData to the TCP server
-// and unmarshal the response into resDst.
-func (app *application) sendToTCPServer(command string, reqData interface{}, resDst interface{}) error {
-	requestData, err := json.Marshal(reqData)
-	if err != nil {
-		return err
-	}
-
-	packet := &tcp.Packet{
-		Command: command,
-		Data:    requestData,
-	}
-	tcpPacket, err := json.Marshal(packet)
-	if err != nil {
-		return err
-	}
-
-	res, err := app.TcpPool.SendData(tcpPacket)
-	if err != nil {
-		return err
-	}
-
-	err = json.Unmarshal(res, resDst)
-	if err != nil {
-		return err
-	}
-
-	return nil
+// and decodes the response into resDst. If the pool was configured with
+// SetLocal and resolves to the same process, this skips the socket entirely.
+// ctx is tied to the incoming HTTP request, so a client disconnect aborts
+// the TCP call instead of leaking it.
+func (app *application) sendToTCPServer(ctx context.Context, command string, codec string, reqData interface{}, resDst interface{}) error {
+	return app.TcpPool.CallTyped(ctx, command, codec, reqData, resDst)
 }
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
+	"os/signal"
+	"syscall"
 
 	"github.com/jseow5177/tcp-pool/internal/model"
 	"github.com/jseow5177/tcp-pool/internal/tcp"
@@ -24,23 +27,37 @@ func main() {
 		Response: &model.LoginUserResponse{},
 	})
 
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
 	// Start TCP server
 	addr := fmt.Sprintf("%s:%d", c.TcpConfig.Host, c.TcpConfig.Port)
 	l, err := net.Listen("tcp", addr)
 	if err != nil {
 		log.Fatalf("error starting tcp server: %s", err.Error())
 	}
-	defer l.Close()
+
+	// Closing the listener is what unblocks Accept() below once ctx is done.
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
 
 	log.Printf("tcp server started at port %d", c.TcpConfig.Port)
 
 	// Accept TCP connections
 	for {
-		c, err := l.Accept()
+		conn, err := l.Accept()
 		if err != nil {
-			log.Fatalf("tcp server failed to connect, err: %v\n", err)
+			select {
+			case <-ctx.Done():
+				log.Printf("tcp server shutting down")
+				return
+			default:
+				log.Fatalf("tcp server failed to connect, err: %v\n", err)
+			}
 		}
-		go tcp.HandleClientConnection(c)
+		go tcp.HandleClientConnection(conn)
 	}
 }
 
@@ -2,6 +2,7 @@ package conf
 
 import (
 	"flag"
+	"time"
 
 	"github.com/jseow5177/tcp-pool/internal/tcp"
 )
@@ -11,6 +12,11 @@ type Config struct {
 	TcpConfig  *tcp.TcpConfig
 }
 
+// CmdLoginUser is the TCP command name for the login_user handler, shared by
+// app/http, app/tcp and app/combined so the HTTP frontend and TCP backend
+// agree on it without a duplicated string literal.
+const CmdLoginUser = "login_user"
+
 type HttpConfig struct {
 	Host string
 	Port int
@@ -23,10 +29,15 @@ func InitConfig() *Config {
 			Port: *flag.Int("http-port", 3030, "port of http server"),
 		},
 		TcpConfig: &tcp.TcpConfig{
-			Host:         *flag.String("tcp-host", "localhost", "host of tcp server"),
-			Port:         *flag.Int("tcp-port", 4000, "port of tcp server"),
-			MaxIdleConns: *flag.Int("max-idle", 1, "max number of idle tcp conns"),
-			MaxOpenConn:  *flag.Int("max-open", 0, "max number of open tcp conns"),
+			Host:               *flag.String("tcp-host", "localhost", "host of tcp server"),
+			Port:               *flag.Int("tcp-port", 4000, "port of tcp server"),
+			MaxOpenConn:        *flag.Int("max-open", 0, "max number of open tcp conns"),
+			MaxInflightPerConn: *flag.Int("max-inflight", 0, "max number of in-flight requests per tcp conn, 0 for no limit"),
+
+			KeepAliveInterval: *flag.Duration("keep-alive-interval", 0, "interval to probe idle tcp conns, 0 to disable"),
+			KeepAliveTimeout:  *flag.Duration("keep-alive-timeout", 3*time.Second, "timeout to wait for a keepalive pong"),
+			MaxConnLifetime:   *flag.Duration("max-conn-lifetime", 0, "max lifetime of a tcp conn, 0 for no limit"),
+			MaxIdleTime:       *flag.Duration("max-idle-time", 0, "max idle time of a tcp conn, 0 for no limit"),
 		},
 	}
 
@@ -0,0 +1,58 @@
+package tcp
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestJSONCodecRoundTrip(t *testing.T) {
+	type payload struct {
+		Name string `json:"name"`
+	}
+
+	data, err := Marshal(JSONCodecName, &payload{Name: "salom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out payload
+	if err := Unmarshal(JSONCodecName, data, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Name != "salom" {
+		t.Errorf("got %q, want %q", out.Name, "salom")
+	}
+}
+
+// TestProtoCodecRoundTrip exercises protoCodec against wrapperspb.StringValue,
+// a minimal message from the well-known types rather than a hand-generated
+// one, so the test needs no protoc step to stay in sync with a .proto file.
+func TestProtoCodecRoundTrip(t *testing.T) {
+	data, err := Marshal(ProtoCodecName, wrapperspb.String("salom"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &wrapperspb.StringValue{}
+	if err := Unmarshal(ProtoCodecName, data, out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Value != "salom" {
+		t.Errorf("got %q, want %q", out.Value, "salom")
+	}
+}
+
+func TestProtoCodecRejectsNonProtoMessage(t *testing.T) {
+	if _, err := Marshal(ProtoCodecName, struct{}{}); err != ErrNotProtoMessage {
+		t.Errorf("got %v, want %v", err, ErrNotProtoMessage)
+	}
+}
+
+func TestMarshalUnknownCodec(t *testing.T) {
+	if _, err := Marshal("does-not-exist", struct{}{}); err != ErrUnknownCodec {
+		t.Errorf("got %v, want %v", err, ErrUnknownCodec)
+	}
+}
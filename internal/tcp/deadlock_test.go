@@ -1,31 +1,39 @@
 package tcp
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
 func TestDeadlock(t *testing.T) {
 	var wg sync.WaitGroup
-	wg.Add(1)
 
 	wait := make(chan struct{}, 1)
+	var closing int32 // set just before the safety-valve goroutine closes l
 
+	// This goroutine outlives the test on purpose (see the safety valve
+	// below); it is intentionally not tracked by wg so wg.Wait() only
+	// waits for the two Call()s below, not a full 10s.
 	go func() {
-		defer wg.Done()
-
 		l, err := net.Listen("tcp", "127.0.0.1:11011")
 		if err != nil {
 			t.Error(err)
+			return
 		}
 
+		// Safety valve: force the listener closed if the test never
+		// finishes, so a real deadlock doesn't hang the suite forever.
 		go func() {
 			<-time.After(10 * time.Second)
 
+			atomic.StoreInt32(&closing, 1)
 			l.Close()
 		}()
 
@@ -34,7 +42,11 @@ func TestDeadlock(t *testing.T) {
 		for {
 			c, err := l.Accept()
 			if err != nil {
-				t.Error(err)
+				// Expected once the safety valve above fires; anything
+				// else is a genuine test failure.
+				if atomic.LoadInt32(&closing) == 0 {
+					t.Error(err)
+				}
 				break
 			}
 
@@ -48,15 +60,35 @@ func TestDeadlock(t *testing.T) {
 						return
 					}
 
-					log.Println("Ping:", string(data))
-
-					time.Sleep(1)
-
-					_, err = conn.Write([]byte("Pong: " + string(data)))
-					if err != nil {
+					packet := &Packet{}
+					if err := json.Unmarshal(data, packet); err != nil {
 						t.Error(err)
 						return
 					}
+
+					log.Println("Ping:", string(packet.Data))
+
+					// Reply to each request on its own goroutine, and make
+					// the request with RequestID 1 sleep the longest, so the
+					// server answers RequestID 2 first. This is
+					// only a real multiplexing test if replies can arrive
+					// out of order and still land on the right caller.
+					go func(packet *Packet) {
+						time.Sleep(time.Duration(10-packet.RequestID) * 20 * time.Millisecond)
+
+						resp, err := json.Marshal(&Packet{
+							Data:      []byte("Pong: " + string(packet.Data)),
+							RequestID: packet.RequestID,
+						})
+						if err != nil {
+							t.Error(err)
+							return
+						}
+
+						if _, err := conn.Write(resp); err != nil {
+							t.Error(err)
+						}
+					}(packet)
 				}
 			}(c)
 		}
@@ -64,26 +96,35 @@ func TestDeadlock(t *testing.T) {
 
 	<-wait
 
+	// MaxInflightPerConn is left at its zero value (unlimited) so both
+	// Call()s below are genuinely multiplexed over the single open
+	// connection, rather than serialized the way a MaxInflightPerConn: 1
+	// cap would force them to be.
 	pool, _ := CreateTcpConnPool(&TcpConfig{
-		Host:         "127.0.0.1",
-		Port:         11011,
-		MaxIdleConns: 1,
-		MaxOpenConn:  1,
+		Host:        "127.0.0.1",
+		Port:        11011,
+		MaxOpenConn: 1,
 	})
 
 	for i := 0; i < 2; i++ {
 		wg.Add(1)
 
 		go func(k int) {
+			defer wg.Done()
+
 			log.Println("Send ping:", k)
 
-			resp, err := pool.SendData([]byte(fmt.Sprintf("Salom [%d]", k)))
+			want := fmt.Sprintf("Pong: Salom [%d]", k)
+			resp, err := pool.Call(context.Background(), "ping", JSONCodecName, []byte(fmt.Sprintf("Salom [%d]", k)))
 			if err != nil {
 				t.Error(err)
+				return
 			}
 
 			log.Println(string(resp))
-			wg.Done()
+			if string(resp) != want {
+				t.Errorf("call %d got response %q, want %q (response correlated with the wrong request)", k, resp, want)
+			}
 		}(i)
 	}
 
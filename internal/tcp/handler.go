@@ -3,6 +3,8 @@ package tcp
 import (
 	"encoding/json"
 	"net"
+	"reflect"
+	"sync"
 )
 
 // A map of commands to handler functions
@@ -24,56 +26,160 @@ func RegisterHandler(hc *HandlerConfig) {
 	handlers[hc.Command] = hc
 }
 
-// HandleClientConnection() handles a connection from client
-// It runs in a loop while waiting to read data
+// HandleClientConnection() handles a connection from client.
+// Each request is dispatched to its own goroutine so a slow handler can't
+// block other requests multiplexed on the same connection; a single writer
+// goroutine serializes every response, echoing back the RequestID of the
+// request it answers.
 func HandleClientConnection(conn net.Conn) {
-	var (
-		err        error
-		data       []byte
-		response   []byte
-		clientConn = &tcpConn{conn: conn}
-	)
+	clientConn := &tcpConn{conn: conn}
+	writeChan := make(chan []byte, 64)
 
-	defer func() {
-		if err != nil {
-			conn.Close()
+	defer conn.Close()
+
+	go func() {
+		for data := range writeChan {
+			if _, err := clientConn.Write(data); err != nil {
+				return
+			}
 		}
 	}()
 
+	var wg sync.WaitGroup
+	defer func() {
+		// Wait for every in-flight handleRequest() to finish before closing
+		// writeChan: respond()/respondErr() send on it, and closing out
+		// from under a goroutine still writing would panic.
+		wg.Wait()
+		close(writeChan)
+	}()
+
 	for {
-		data, err = clientConn.Read()
+		data, err := clientConn.Read()
 		if err != nil {
 			return
 		}
 
 		packet := &Packet{}
-		err = json.Unmarshal(data, &packet)
-		if err != nil {
+		if err := json.Unmarshal(data, packet); err != nil {
 			return
 		}
 
-		handlerCfg, exist := handlers[packet.Command]
-		if !exist {
-			err = ErrMissingHandler
-			return
-		}
+		wg.Add(1)
+		go func(packet *Packet) {
+			defer wg.Done()
+			handleRequest(packet, writeChan)
+		}(packet)
+	}
+}
 
-		err = json.Unmarshal(packet.Data, handlerCfg.Request)
-		if err != nil {
-			return
-		}
+// handleRequest() dispatches a single request packet to its registered
+// handler (or the built-in keepalive ping) and queues the response for the
+// connection's writer goroutine, echoing the original RequestID. A
+// dispatch failure (missing handler, bad codec) is sent back as an error
+// packet rather than dropped, so the caller's Call() fails immediately
+// instead of hanging until its ctx deadline.
+func handleRequest(packet *Packet, writeChan chan<- []byte) {
+	// Built-in keepalive probe: reply with a pong without touching the
+	// user-registered handler map.
+	if packet.Command == pingCommand {
+		respond(writeChan, packet.RequestID, []byte(pongPayload))
+		return
+	}
 
-		// Route client request to handler
-		handlerCfg.Handler(handlerCfg.Request, handlerCfg.Response)
+	response, err := dispatchLocal(packet.Command, packet.Codec, packet.Data)
+	if err != nil {
+		respondErr(writeChan, packet.RequestID, err)
+		return
+	}
 
-		response, err = json.Marshal(handlerCfg.Response)
-		if err != nil {
-			return
-		}
+	respond(writeChan, packet.RequestID, response)
+}
 
-		_, err = clientConn.Write(response)
-		if err != nil {
-			return
-		}
+// newHandlerArgs() allocates a fresh Request/Response pair for a single
+// call, rather than reusing the ones on HandlerConfig, since requests for
+// the same command can now run concurrently (one goroutine per request,
+// see HandleClientConnection, plus in-process dispatchLocal callers).
+func newHandlerArgs(hc *HandlerConfig) (req interface{}, res interface{}) {
+	req = reflect.New(reflect.TypeOf(hc.Request).Elem()).Interface()
+	res = reflect.New(reflect.TypeOf(hc.Response).Elem()).Interface()
+	return req, res
+}
+
+// dispatchLocal() runs the handler registered for command directly against
+// data, without touching a net.Conn. It is the shared core behind both
+// HandleClientConnection() (reading data off the wire) and DispatchLocal()
+// (called in-process), so the two paths behave identically.
+func dispatchLocal(command string, codecName string, data []byte) ([]byte, error) {
+	handlerCfg, exist := handlers[command]
+	if !exist {
+		return nil, ErrMissingHandler
 	}
+
+	codec, err := getCodec(codecName)
+	if err != nil {
+		return nil, err
+	}
+
+	req, res := newHandlerArgs(handlerCfg)
+
+	if err := codec.Unmarshal(data, req); err != nil {
+		return nil, err
+	}
+
+	handlerCfg.Handler(req, res)
+
+	return codec.Marshal(res)
+}
+
+// DispatchLocal invokes the handler registered for command directly,
+// bypassing the network entirely, for callers running the TCP server's
+// handlers in the same process as their caller. reqJSON is expected to be
+// JSON-encoded; callers using a different codec should go through
+// (*TcpConnPool).Call or CallTyped instead.
+func DispatchLocal(command string, reqJSON []byte) ([]byte, error) {
+	return dispatchLocal(command, JSONCodecName, reqJSON)
+}
+
+// DispatchLocalTyped invokes the handler registered for command directly
+// with req/res already typed, skipping both the codec and the network. It
+// is meant to be passed as the dispatch func to (*TcpConnPool).SetLocal
+// when the HTTP frontend and TCP backend are wired into the same binary,
+// so CallTyped's round trip through a handler collapses to a direct call.
+func DispatchLocalTyped(command string, req interface{}, res interface{}) error {
+	handlerCfg, exist := handlers[command]
+	if !exist {
+		return ErrMissingHandler
+	}
+
+	handlerCfg.Handler(req, res)
+
+	return nil
+}
+
+// respond() marshals a response Packet carrying the given RequestID and
+// queues it for the writer goroutine.
+func respond(writeChan chan<- []byte, requestID uint64, data []byte) {
+	packet := &Packet{Data: data, RequestID: requestID}
+
+	respBytes, err := json.Marshal(packet)
+	if err != nil {
+		return
+	}
+
+	writeChan <- respBytes
+}
+
+// respondErr() marshals a response Packet carrying err's message instead
+// of a Data payload, so the caller's pending call fails the moment it
+// arrives rather than timing out.
+func respondErr(writeChan chan<- []byte, requestID uint64, err error) {
+	packet := &Packet{RequestID: requestID, Error: err.Error()}
+
+	respBytes, marshalErr := json.Marshal(packet)
+	if marshalErr != nil {
+		return
+	}
+
+	writeChan <- respBytes
 }
@@ -0,0 +1,179 @@
+package tcp
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// startEchoServer starts a TCP server that replies to every ping with a
+// pong (and otherwise echoes the payload back), for tests that only care
+// about connection lifecycle rather than a specific handler.
+func startEchoServer(t *testing.T) (addr string, stop func()) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(cc net.Conn) {
+				conn := tcpConn{conn: cc}
+				for {
+					data, err := conn.Read()
+					if err != nil {
+						return
+					}
+
+					packet := &Packet{}
+					if err := json.Unmarshal(data, packet); err != nil {
+						return
+					}
+
+					payload := []byte(packet.Data)
+					if packet.Command == pingCommand {
+						payload = []byte(pongPayload)
+					}
+
+					resp, err := json.Marshal(&Packet{Data: payload, RequestID: packet.RequestID})
+					if err != nil {
+						return
+					}
+					if _, err := conn.Write(resp); err != nil {
+						return
+					}
+				}
+			}(c)
+		}
+	}()
+
+	return l.Addr().String(), func() { l.Close() }
+}
+
+// TestKeepAliveEvictsConnPastMaxConnLifetime covers the double-terminate bug
+// fixed earlier: keepAlive() evicting a conn via MaxConnLifetime must not
+// leave numOpen decremented twice even though the conn can also be reached
+// via fail()/terminate() from other paths.
+func TestKeepAliveEvictsConnPastMaxConnLifetime(t *testing.T) {
+	addr, stop := startEchoServer(t)
+	defer stop()
+
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool, err := CreateTcpConnPool(&TcpConfig{
+		Host:              host,
+		Port:              port,
+		MaxOpenConn:       1,
+		KeepAliveInterval: 20 * time.Millisecond,
+		KeepAliveTimeout:  time.Second,
+		MaxConnLifetime:   30 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := pool.Call(context.Background(), "echo", JSONCodecName, []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := pool.Stats().NumOpen; got != 1 {
+		t.Fatalf("NumOpen = %d, want 1 right after the first call", got)
+	}
+
+	// Give keepAlive a few ticks to notice the conn has outlived
+	// MaxConnLifetime and evict it.
+	deadline := time.Now().Add(500 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		if pool.Stats().NumOpen == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := pool.Stats().NumOpen; got != 0 {
+		t.Fatalf("NumOpen = %d, want 0 after MaxConnLifetime eviction", got)
+	}
+
+	// A second Call() should transparently open a fresh conn; if eviction
+	// had double-decremented numOpen, it would have gone negative instead
+	// of back to a clean 0, and this call would still succeed either way,
+	// masking the bug, so we assert on Stats() above rather than here.
+	if _, err := pool.Call(context.Background(), "echo", JSONCodecName, []byte("hi again")); err != nil {
+		t.Fatal(err)
+	}
+	if got := pool.Stats().NumOpen; got != 1 {
+		t.Fatalf("NumOpen = %d, want 1 after reconnecting", got)
+	}
+}
+
+// TestStatsTracksWaitCount covers chunk0-6's Stats()/expvar addition: a
+// caller forced to queue behind MaxOpenConn should show up in WaitCount and
+// WaitDuration.
+func TestStatsTracksWaitCount(t *testing.T) {
+	addr, stop := startEchoServer(t)
+	defer stop()
+
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool, err := CreateTcpConnPool(&TcpConfig{
+		Host:               host,
+		Port:               port,
+		MaxOpenConn:        1,
+		MaxInflightPerConn: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hold the pool's only connection for a while, so a concurrent Call()
+	// below has no choice but to queue in requestChan and show up in
+	// WaitCount/WaitDuration.
+	c, err := pool.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		pool.release(c)
+	}()
+
+	if _, err := pool.Call(context.Background(), "echo", JSONCodecName, []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := pool.Stats()
+	if stats.NumOpen != 1 {
+		t.Errorf("NumOpen = %d, want 1", stats.NumOpen)
+	}
+	if stats.WaitCount == 0 {
+		t.Errorf("WaitCount = 0, want at least 1 (the Call above should have queued)")
+	}
+	if stats.WaitDuration == 0 {
+		t.Errorf("WaitDuration = 0, want non-zero")
+	}
+}
@@ -0,0 +1,61 @@
+package tcp
+
+import (
+	"context"
+	"testing"
+)
+
+type echoRequest struct {
+	Msg string `json:"msg"`
+}
+
+type echoResponse struct {
+	Msg string `json:"msg"`
+}
+
+func TestDispatchLocalMatchesHandler(t *testing.T) {
+	RegisterHandler(&HandlerConfig{
+		Command: "echo",
+		Handler: func(req interface{}, res interface{}) {
+			res.(*echoResponse).Msg = req.(*echoRequest).Msg
+		},
+		Request:  &echoRequest{},
+		Response: &echoResponse{},
+	})
+
+	reqData, err := Marshal(JSONCodecName, &echoRequest{Msg: "salom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resData, err := DispatchLocal("echo", reqData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var res echoResponse
+	if err := Unmarshal(JSONCodecName, resData, &res); err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Msg != "salom" {
+		t.Errorf("got %q, want %q", res.Msg, "salom")
+	}
+}
+
+func TestCallTypedUsesLocalDispatch(t *testing.T) {
+	pool := &TcpConnPool{host: "127.0.0.1", port: 19999}
+	pool.SetLocal("127.0.0.1:19999", func(command string, req interface{}, res interface{}) error {
+		res.(*echoResponse).Msg = "from local dispatch"
+		return nil
+	})
+
+	var res echoResponse
+	if err := pool.CallTyped(context.Background(), "echo", JSONCodecName, &echoRequest{Msg: "ignored"}, &res); err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Msg != "from local dispatch" {
+		t.Errorf("got %q, want %q", res.Msg, "from local dispatch")
+	}
+}
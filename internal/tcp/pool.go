@@ -1,12 +1,16 @@
 package tcp
 
 import (
+	"context"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
+	"expvar"
 	"fmt"
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -17,39 +21,97 @@ var (
 	ErrMissingHandler    = errors.New("handler not registered")
 	ErrRead              = errors.New("cannot read data from tcp connection")
 	ErrWrite             = errors.New("cannot write data into tcp connection")
+	ErrPoolClosed        = errors.New("connection pool closed")
 )
 
 const (
 	prefixSize     = 4      // 4 bytes
 	maxQueueLength = 10_000 // max 10,000 connection requests in queue
+
+	// pingCommand is a reserved Packet.Command used internally to probe
+	// whether an idle connection is still alive. It is handled by
+	// HandleClientConnection() directly, so users never need to register it.
+	pingCommand = "__ping__"
+	pongPayload = "__pong__"
 )
 
 // An atomic piece of wrapper used to transmit data
 // between the HTTP client and TCP server.
 // Command specifies which function to call on the TCP server to handle Data.
+// RequestID correlates a response on a shared connection back to the call
+// that made it, so a single tcpConn can multiplex many in-flight requests.
+// Codec names how Data was encoded (see Codec), so the server can decode it
+// without assuming JSON; it defaults to JSONCodecName when empty. Error
+// carries a handler/dispatch failure back to the caller on the response
+// packet, so a missing handler or a bad codec fails the waiting Call()
+// immediately instead of leaving it to hang until its ctx deadline.
 type Packet struct {
-	Command string
-	Data    []byte
+	Command   string
+	Data      []byte
+	RequestID uint64
+	Codec     string
+	Error     string
 }
 
 // TcpConfig is a set of configurations for a TCP connection pool
 type TcpConfig struct {
-	Host         string
-	Port         int
-	MaxIdleConns int
-	MaxOpenConn  int
+	Host        string
+	Port        int
+	MaxOpenConn int
+	// MaxInflightPerConn caps how many requests may be multiplexed on a
+	// single connection at once. A value of 0 means no limit.
+	MaxInflightPerConn int
+
+	// KeepAliveInterval is how often idle connections are probed with a
+	// ping packet. A value of 0 disables keepalive probing.
+	KeepAliveInterval time.Duration
+	// KeepAliveTimeout is how long to wait for a pong before the
+	// connection is considered dead and evicted.
+	KeepAliveTimeout time.Duration
+	// MaxConnLifetime is the max amount of time a connection may be
+	// reused for, since it was opened. A value of 0 means no limit.
+	MaxConnLifetime time.Duration
+	// MaxIdleTime is the max amount of time a connection may sit with no
+	// in-flight requests before it is evicted. A value of 0 means no limit.
+	MaxIdleTime time.Duration
+}
+
+// pendingCall tracks a single in-flight request waiting for its response
+// to arrive on the connection's reader goroutine.
+type pendingCall struct {
+	dataChan chan []byte
+	errChan  chan error
 }
 
-// tcpConn is a wrapper for a single tcp connection
+// tcpConn is a wrapper for a single tcp connection. A tcpConn is shared by
+// every in-flight Call() made against it: one writer goroutine serializes
+// outgoing packets, one reader goroutine demultiplexes responses by
+// RequestID back to their waiting caller.
 type tcpConn struct {
 	id   string       // A unique id to identify a connection
 	pool *TcpConnPool // The TCP connecion pool
 	conn net.Conn     // The underlying TCP connection
+
+	createdAt time.Time // when the connection was opened
+	usedAt    time.Time // when the connection last dropped to 0 in-flight Call()s (keepalive probes excluded)
+
+	nextReqID uint64 // atomic counter used to allocate RequestIDs
+	inflight  int32  // atomic count of requests currently in flight on this conn
+
+	writeChan chan []byte   // outgoing packets awaiting the writer goroutine
+	dead      chan struct{} // closed once the conn is torn down (see terminateWithErr)
+
+	mu      sync.Mutex // guards pending
+	pending map[uint64]*pendingCall
+
+	terminateOnce sync.Once // makes terminateWithErr() safe from both keepAlive/Close and fail()
 }
 
-// connRequest wraps a channel to receive a connection
-// and a channel to receive an error
+// connRequest wraps a channel to receive a connection and a channel to
+// receive an error. ctx lets a queued request abandon itself the moment
+// its caller gives up, instead of holding a slot until a hardcoded timeout.
 type connRequest struct {
+	ctx      context.Context
 	connChan chan *tcpConn
 	errChan  chan error
 }
@@ -59,11 +121,98 @@ type TcpConnPool struct {
 	host         string
 	port         int
 	mu           sync.Mutex          // mutex to prevent race conditions in concurrent access
-	idleConns    map[string]*tcpConn // holds the idle connections
+	conns        map[string]*tcpConn // holds every open connection, keyed by id
 	numOpen      int                 // counter that tracks open connections
 	maxOpenCount int
-	maxIdleCount int
+	maxInflight  int
 	requestChan  chan *connRequest // A queue of connection requests
+
+	keepAliveInterval time.Duration
+	keepAliveTimeout  time.Duration
+	maxConnLifetime   time.Duration
+	maxIdleTime       time.Duration
+
+	localAddr     string                                                       // set via SetLocal; host:port this pool bypasses the network for
+	localDispatch func(command string, req interface{}, res interface{}) error // optional typed bypass used by CallTyped
+
+	closed  bool          // set by Close(); acquire() refuses new work once true
+	closeCh chan struct{} // closed alongside closed, to stop the keepAlive loop
+
+	// Metrics backing Stats(), all updated with atomic ops so Stats() never
+	// needs to block a caller on p.mu.
+	waitCount      int64 // callers that had to queue in requestChan
+	waitDurationNs int64 // cumulative time spent queued, across all callers
+	timeoutCount   int64 // queued callers whose ctx expired before a conn freed up
+	maxOpenReached int64 // times a new conn couldn't open because MaxOpenConn was hit
+}
+
+// Stats is a point-in-time snapshot of pool activity, in the style of
+// database/sql.DB.Stats().
+type Stats struct {
+	NumOpen int // connections currently open
+	NumIdle int // open connections with no in-flight requests
+
+	WaitCount    int64         // total callers that had to queue for a connection
+	WaitDuration time.Duration // total time spent queued, across all callers
+	TimeoutCount int64         // queued callers whose ctx expired before a conn freed up
+
+	MaxOpenReached int64 // times a new conn couldn't open because MaxOpenConn was hit
+}
+
+// Stats returns a snapshot of the pool's current activity. Callers running
+// the HTTP proxy under load can poll this (or PublishExpvar it) to see
+// whether they're saturating MaxOpenConn or piling up in requestChan.
+func (p *TcpConnPool) Stats() Stats {
+	p.mu.Lock()
+	numOpen := p.numOpen
+	numIdle := 0
+	for _, c := range p.conns {
+		if atomic.LoadInt32(&c.inflight) == 0 {
+			numIdle++
+		}
+	}
+	p.mu.Unlock()
+
+	return Stats{
+		NumOpen:      numOpen,
+		NumIdle:      numIdle,
+		WaitCount:    atomic.LoadInt64(&p.waitCount),
+		WaitDuration: time.Duration(atomic.LoadInt64(&p.waitDurationNs)),
+		TimeoutCount: atomic.LoadInt64(&p.timeoutCount),
+
+		MaxOpenReached: atomic.LoadInt64(&p.maxOpenReached),
+	}
+}
+
+// PublishExpvar registers the pool's Stats() under name via expvar, so it
+// shows up at the process's /debug/vars endpoint and can be scraped by
+// anything that understands expvar's JSON. It is optional: a pool that
+// never calls this incurs no expvar overhead.
+func (p *TcpConnPool) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return p.Stats()
+	}))
+}
+
+// SetLocal configures the pool to short-circuit into dispatch whenever its
+// own host:port matches addr, instead of dialing out, for the common case
+// of the HTTP frontend and TCP backend sharing one binary. dispatch is only
+// used by CallTyped; Call still bypasses the network via dispatchLocal.
+func (p *TcpConnPool) SetLocal(addr string, dispatch func(command string, req interface{}, res interface{}) error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.localAddr = addr
+	p.localDispatch = dispatch
+}
+
+// isLocal() reports whether the pool is configured to bypass the network
+// for its own host:port.
+func (p *TcpConnPool) isLocal() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.localAddr != "" && p.localAddr == fmt.Sprintf("%s:%d", p.host, p.port)
 }
 
 // CreateTcpConnPool() creates a connection pool
@@ -72,17 +221,73 @@ func CreateTcpConnPool(cfg *TcpConfig) (*TcpConnPool, error) {
 	pool := &TcpConnPool{
 		host:         cfg.Host,
 		port:         cfg.Port,
-		idleConns:    make(map[string]*tcpConn),
+		conns:        make(map[string]*tcpConn),
 		requestChan:  make(chan *connRequest, maxQueueLength),
+		closeCh:      make(chan struct{}),
 		maxOpenCount: cfg.MaxOpenConn,
-		maxIdleCount: cfg.MaxIdleConns,
+		maxInflight:  cfg.MaxInflightPerConn,
+
+		keepAliveInterval: cfg.KeepAliveInterval,
+		keepAliveTimeout:  cfg.KeepAliveTimeout,
+		maxConnLifetime:   cfg.MaxConnLifetime,
+		maxIdleTime:       cfg.MaxIdleTime,
 	}
 
 	go pool.handleConnectionRequest()
 
+	if pool.keepAliveInterval > 0 {
+		go pool.keepAlive()
+	}
+
 	return pool, nil
 }
 
+// Close shuts the pool down gracefully: it stops accepting new work with
+// ErrPoolClosed, fails every request still queued in requestChan, then
+// waits up to ctx for each open connection's in-flight calls to finish
+// before force-closing its socket.
+func (p *TcpConnPool) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrPoolClosed
+	}
+	p.closed = true
+	close(p.closeCh)
+
+	conns := make([]*tcpConn, 0, len(p.conns))
+	for _, c := range p.conns {
+		conns = append(conns, c)
+	}
+	p.mu.Unlock()
+
+	// No further connRequests can be queued now that p.closed is true, so
+	// draining requestChan here fails only requests already waiting.
+	close(p.requestChan)
+
+	for _, c := range conns {
+		waitConnIdle(ctx, c)
+		p.terminate(c)
+	}
+
+	return nil
+}
+
+// waitConnIdle polls c's in-flight count until it reaches 0 or ctx is done,
+// whichever comes first.
+func waitConnIdle(ctx context.Context, c *tcpConn) {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for atomic.LoadInt32(&c.inflight) > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 // createTcpBuffer() implements the TCP protocol used in this application
 // A stream of TCP data to be sent over has two parts: a prefix and the actual data itself
 // The prefix is a fixed length byte that states how much data is being transferred over (including the prefix)
@@ -150,88 +355,295 @@ func (c *tcpConn) Write(data []byte) (int, error) {
 	return n, nil
 }
 
-// terminate() closes a connection and removes it from the idle pool
-func (p *TcpConnPool) terminate(tcpConn *tcpConn) {
-	tcpConn.conn.Close()
-	delete(p.idleConns, tcpConn.id)
+// startPipeline() starts the writer and reader goroutines that let a single
+// tcpConn multiplex many concurrent Call()s.
+func (c *tcpConn) startPipeline() {
+	c.pending = make(map[uint64]*pendingCall)
+	c.writeChan = make(chan []byte, 64)
+	c.dead = make(chan struct{})
+
+	go c.writeLoop()
+	go c.readLoop()
+}
+
+// writeLoop() serializes every outgoing packet onto the underlying
+// connection so concurrent callers never interleave writes.
+func (c *tcpConn) writeLoop() {
+	for data := range c.writeChan {
+		if _, err := c.Write(data); err != nil {
+			c.fail(err)
+			return
+		}
+	}
 }
 
-// SendData() sends data to the TCP connection, reads response, and releases the connection
-func (p *TcpConnPool) SendData(data []byte) ([]byte, error) {
-	// Get a new TCP connection
-	tcpConn, err := p.get()
+// readLoop() reads packets off the connection and routes each one back to
+// the caller waiting on its RequestID.
+func (c *tcpConn) readLoop() {
+	for {
+		data, err := c.Read()
+		if err != nil {
+			c.fail(err)
+			return
+		}
+
+		packet := &Packet{}
+		if err := json.Unmarshal(data, packet); err != nil {
+			c.fail(err)
+			return
+		}
+
+		c.mu.Lock()
+		pc, ok := c.pending[packet.RequestID]
+		if ok {
+			delete(c.pending, packet.RequestID)
+		}
+		c.mu.Unlock()
+
+		if !ok {
+			continue
+		}
+
+		if packet.Error != "" {
+			pc.errChan <- errors.New(packet.Error)
+		} else {
+			pc.dataChan <- packet.Data
+		}
+	}
+}
+
+// fail() tears down the conn once, failing every call still waiting on it
+// with the error that woke readLoop/writeLoop up.
+func (c *tcpConn) fail(err error) {
+	c.pool.terminateWithErr(c, err)
+}
+
+// terminate() tears a connection down with ErrConnectionClosed. It is
+// reached directly by keepAlive (evicting an idle conn) and Close
+// (shutting the pool down), where there is no specific I/O error to
+// report; fail() calls terminateWithErr directly instead, so a call still
+// pending on a broken conn sees the real cause.
+func (p *TcpConnPool) terminate(c *tcpConn) {
+	p.terminateWithErr(c, ErrConnectionClosed)
+}
+
+// terminateWithErr() removes c from the pool first (so no concurrent
+// pickConn() can hand it out once this starts), then closes its socket,
+// wakes up anything still waiting on it via c.dead (failing pending calls
+// with err), and closes writeChan so writeLoop() can return instead of
+// ranging over it forever. terminateOnce makes this safe to call from
+// both keepAlive/Close and fail() for the same conn.
+func (p *TcpConnPool) terminateWithErr(c *tcpConn, err error) {
+	c.terminateOnce.Do(func() {
+		p.mu.Lock()
+		delete(p.conns, c.id)
+		p.numOpen--
+		p.mu.Unlock()
+
+		c.conn.Close()
+		close(c.dead)
+
+		c.mu.Lock()
+		pending := c.pending
+		c.pending = make(map[uint64]*pendingCall)
+		c.mu.Unlock()
+
+		for _, pc := range pending {
+			pc.errChan <- err
+		}
+
+		close(c.writeChan)
+	})
+}
+
+// Call() sends command/data to the TCP server and waits for the matching
+// response. Unlike the old SendData(), it does not check out a whole
+// connection: the request is multiplexed onto a shared tcpConn alongside
+// any other in-flight calls, identified by a RequestID. data is expected to
+// already be encoded with the named codec (see Marshal); codec travels
+// alongside the request so the server knows how to decode it.
+func (p *TcpConnPool) Call(ctx context.Context, command string, codec string, data []byte) ([]byte, error) {
+	if p.isLocal() {
+		return dispatchLocal(command, codec, data)
+	}
+
+	c, err := p.acquire(ctx)
 	if err != nil {
 		return nil, err
 	}
+	defer p.release(c)
+
+	reqID := atomic.AddUint64(&c.nextReqID, 1)
 
-	// Write data into the underlying connection
-	_, err = tcpConn.Write(data)
+	pc := &pendingCall{
+		dataChan: make(chan []byte, 1),
+		errChan:  make(chan error, 1),
+	}
+
+	c.mu.Lock()
+	c.pending[reqID] = pc
+	c.mu.Unlock()
+
+	packet := &Packet{Command: command, Data: data, RequestID: reqID, Codec: codec}
+	packetBytes, err := json.Marshal(packet)
 	if err != nil {
-		p.terminate(tcpConn)
 		return nil, err
 	}
 
-	// Read response data from the underlying connection
-	resBuf, err := tcpConn.Read()
-	if err != nil {
-		p.terminate(tcpConn)
+	forgetPending := func() {
+		c.mu.Lock()
+		delete(c.pending, reqID)
+		c.mu.Unlock()
+	}
+
+	select {
+	case c.writeChan <- packetBytes:
+	case <-c.dead:
+		forgetPending()
+		return nil, ErrConnectionClosed
+	case <-ctx.Done():
+		forgetPending()
+		return nil, ctx.Err()
+	}
+
+	select {
+	case resData := <-pc.dataChan:
+		return resData, nil
+	case err := <-pc.errChan:
 		return nil, err
+	case <-ctx.Done():
+		forgetPending()
+		return nil, ctx.Err()
+	}
+}
+
+// CallTyped encodes req, calls command, and decodes the response into res,
+// all with the named codec. When the pool is local (see SetLocal) and a
+// dispatch func was registered, req/res are handed to it directly, skipping
+// both the codec and the socket — this is what gives the HTTP↔TCP proxy its
+// latency win, with no change required from CallTyped's own callers.
+func (p *TcpConnPool) CallTyped(ctx context.Context, command string, codec string, req interface{}, res interface{}) error {
+	if p.isLocal() {
+		p.mu.Lock()
+		dispatch := p.localDispatch
+		p.mu.Unlock()
+
+		if dispatch != nil {
+			return dispatch(command, req, res)
+		}
+	}
+
+	data, err := Marshal(codec, req)
+	if err != nil {
+		return err
 	}
 
-	// Releases the connection back to the pool
-	p.release(tcpConn)
+	resData, err := p.Call(ctx, command, codec, data)
+	if err != nil {
+		return err
+	}
 
-	return resBuf, nil
+	return Unmarshal(codec, resData, res)
 }
 
-// release() attempts to return a used connection back to the pool
-// It closes the connection if it can't do so
+// release() marks one in-flight request on c as done, freeing up room for
+// another request to be multiplexed onto it.
 func (p *TcpConnPool) release(c *tcpConn) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
+	if atomic.AddInt32(&c.inflight, -1) == 0 {
+		p.mu.Lock()
+		c.usedAt = time.Now()
+		p.mu.Unlock()
+	}
+}
 
-	if p.maxIdleCount > 0 && p.maxIdleCount > len(p.idleConns) {
-		p.idleConns[c.id] = c // put into the pool
-	} else {
-		c.conn.Close()
-		c.pool.numOpen--
+// pickConn() must be called while holding p.mu. It returns the open
+// connection with the fewest in-flight requests that still has room under
+// MaxInflightPerConn, incrementing its in-flight count before returning it.
+func (p *TcpConnPool) pickConn() *tcpConn {
+	var (
+		best     *tcpConn
+		bestLoad int32 = -1
+	)
+
+	for _, c := range p.conns {
+		load := atomic.LoadInt32(&c.inflight)
+		if p.maxInflight > 0 && load >= int32(p.maxInflight) {
+			continue
+		}
+		if best == nil || load < bestLoad {
+			best = c
+			bestLoad = load
+		}
+	}
+
+	if best != nil {
+		atomic.AddInt32(&best.inflight, 1)
 	}
+
+	return best
 }
 
-// get() retrieves a TCP connection
-func (p *TcpConnPool) get() (*tcpConn, error) {
+// acquire() returns a tcpConn to multiplex a request onto, opening a new
+// connection or queueing the caller if the pool is already at MaxOpenConn
+// with every connection full. It respects ctx the same way Call() does.
+func (p *TcpConnPool) acquire(ctx context.Context) (*tcpConn, error) {
 	p.mu.Lock()
 
-	// Case 1: Gets a free connection from the pool if any
-	numIdle := len(p.idleConns)
-	if numIdle > 0 {
-		// Loop map to get one conn
-		for _, c := range p.idleConns {
-			// remove from pool
-			delete(p.idleConns, c.id)
-			p.mu.Unlock()
-			return c, nil
-		}
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+
+	// Case 1: Reuse an open connection that has room for another in-flight request
+	if c := p.pickConn(); c != nil {
+		p.mu.Unlock()
+		return c, nil
 	}
 
 	// Case 2: Queue a connection request
 	if p.maxOpenCount > 0 && p.numOpen >= p.maxOpenCount {
+		atomic.AddInt64(&p.maxOpenReached, 1)
+		atomic.AddInt64(&p.waitCount, 1)
+		waitStart := time.Now()
+
 		// Create the request
 		req := &connRequest{
+			ctx:      ctx,
 			connChan: make(chan *tcpConn, 1),
 			errChan:  make(chan error, 1),
 		}
 		// Queue the request
 		p.requestChan <- req
+		p.mu.Unlock()
 
 		// Waits for either,
-		// 1. Request fulfilled, or
-		// 2. An error is returned
+		// 1. Request fulfilled,
+		// 2. An error is returned, or
+		// 3. The caller's ctx is done, in which case we walk away:
+		//    handleConnectionRequest() checks req.ctx before handing a conn
+		//    to an abandoned request, and a conn it handed over anyway is
+		//    released below, so nothing leaks.
 		select {
 		case tcpConn := <-req.connChan:
+			atomic.AddInt64(&p.waitDurationNs, int64(time.Since(waitStart)))
 			return tcpConn, nil
 		case err := <-req.errChan:
+			atomic.AddInt64(&p.waitDurationNs, int64(time.Since(waitStart)))
+			if ctxErr := ctx.Err(); ctxErr != nil && err == ctxErr {
+				atomic.AddInt64(&p.timeoutCount, 1)
+			}
 			return nil, err
+		case <-ctx.Done():
+			atomic.AddInt64(&p.waitDurationNs, int64(time.Since(waitStart)))
+			atomic.AddInt64(&p.timeoutCount, 1)
+			go func() {
+				select {
+				case c := <-req.connChan:
+					p.release(c)
+				case <-req.errChan:
+				}
+			}()
+			return nil, ctx.Err()
 		}
 	}
 
@@ -247,9 +659,21 @@ func (p *TcpConnPool) get() (*tcpConn, error) {
 		return nil, err
 	}
 
+	atomic.AddInt32(&newTcpConn.inflight, 1)
+
+	p.mu.Lock()
+	p.conns[newTcpConn.id] = newTcpConn
+	p.mu.Unlock()
+
 	return newTcpConn, nil
 }
 
+// connIDCounter allocates tcpConn ids. A monotonic atomic counter, unlike
+// time.Now().UnixNano(), can never collide under concurrent opens on
+// coarse-clock platforms, which would otherwise silently overwrite a live
+// entry in TcpConnPool.conns and leak its socket.
+var connIDCounter uint64
+
 // openNewTcpConnection() creates a new TCP connection at p.host and p.port
 func (p *TcpConnPool) openNewTcpConnection() (*tcpConn, error) {
 	addr := fmt.Sprintf("%s:%d", p.host, p.port)
@@ -259,50 +683,50 @@ func (p *TcpConnPool) openNewTcpConnection() (*tcpConn, error) {
 		return nil, err
 	}
 
-	return &tcpConn{
-		// Use current time as random id
-		id:   fmt.Sprintf("%v", time.Now().UnixNano()),
-		conn: c,
-		pool: p,
-	}, nil
+	now := time.Now()
+	tcpConn := &tcpConn{
+		id:        fmt.Sprintf("%d", atomic.AddUint64(&connIDCounter, 1)),
+		conn:      c,
+		pool:      p,
+		createdAt: now,
+		usedAt:    now,
+	}
+	tcpConn.startPipeline()
+
+	return tcpConn, nil
 }
 
 // handleConnectionRequest() listens to the request queue
 // and attempts to fulfil any incoming requests
 func (p *TcpConnPool) handleConnectionRequest() {
 	for req := range p.requestChan {
-		var (
-			requestDone = false
-			hasTimeout  = false
-
-			// start a 3-second timeout
-			timeoutChan = time.After(3 * time.Second)
-		)
+		requestDone := false
 
-		for {
-			if hasTimeout || requestDone {
-				break
-			}
+		for !requestDone {
 			select {
-			// request timeout
-			case <-timeoutChan:
-				hasTimeout = true
-				req.errChan <- ErrConnectionTimeout
+			// the caller gave up (ctx expired or was canceled): walk away
+			// instead of holding a slot until a hardcoded timeout fires
+			case <-req.ctx.Done():
+				req.errChan <- req.ctx.Err()
+				requestDone = true
 			default:
 				p.mu.Lock()
 
-				// First, we try to get an idle conn.
+				if p.closed {
+					p.mu.Unlock()
+					req.errChan <- ErrPoolClosed
+					requestDone = true
+					continue
+				}
+
+				// First, we try to reuse an open conn with room to spare.
 				// If fail, we try to open a new conn.
-				// If both does not work, we try again in the next loop until timeout.
-				numIdle := len(p.idleConns)
-				if numIdle > 0 {
-					for _, c := range p.idleConns {
-						delete(p.idleConns, c.id)
-						p.mu.Unlock()
-						req.connChan <- c // give conn
-						requestDone = true
-						break
-					}
+				// If both does not work, we try again in the next loop until
+				// the request's ctx is done.
+				if c := p.pickConn(); c != nil {
+					p.mu.Unlock()
+					req.connChan <- c // give conn
+					requestDone = true
 				} else if p.maxOpenCount > 0 && p.numOpen < p.maxOpenCount {
 					p.numOpen++
 					p.mu.Unlock()
@@ -314,6 +738,12 @@ func (p *TcpConnPool) handleConnectionRequest() {
 						p.numOpen--
 						p.mu.Unlock()
 					} else {
+						atomic.AddInt32(&c.inflight, 1)
+
+						p.mu.Lock()
+						p.conns[c.id] = c
+						p.mu.Unlock()
+
 						req.connChan <- c // give conn
 						requestDone = true
 					}
@@ -324,3 +754,99 @@ func (p *TcpConnPool) handleConnectionRequest() {
 		}
 	}
 }
+
+// keepAlive() periodically probes idle connections so that peers (load
+// balancers, NATs) silently dropping a quiet socket is caught here instead
+// of surfacing as a broken-pipe error on the next Call(). It also recycles
+// connections that have exceeded MaxConnLifetime or MaxIdleTime.
+func (p *TcpConnPool) keepAlive() {
+	ticker := time.NewTicker(p.keepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.closeCh:
+			return
+		case <-ticker.C:
+		}
+
+		p.mu.Lock()
+		candidates := make([]*tcpConn, 0, len(p.conns))
+		for _, c := range p.conns {
+			candidates = append(candidates, c)
+		}
+		p.mu.Unlock()
+
+		now := time.Now()
+		for _, c := range candidates {
+			// Only probe connections with no in-flight requests, and claim
+			// the probe itself as an in-flight request so a real Call()
+			// can't be picked off underneath it.
+			if !atomic.CompareAndSwapInt32(&c.inflight, 0, 1) {
+				continue
+			}
+
+			if p.maxConnLifetime > 0 && now.Sub(c.createdAt) > p.maxConnLifetime {
+				atomic.AddInt32(&c.inflight, -1)
+				p.terminate(c)
+				continue
+			}
+			if p.maxIdleTime > 0 && now.Sub(c.usedAt) > p.maxIdleTime {
+				atomic.AddInt32(&c.inflight, -1)
+				p.terminate(c)
+				continue
+			}
+
+			// Drop the probe's in-flight claim without release(), so a
+			// probe does not refresh usedAt and MaxIdleTime still applies.
+			err := p.pingConn(c)
+			atomic.AddInt32(&c.inflight, -1)
+			if err != nil {
+				p.terminate(c)
+			}
+		}
+	}
+}
+
+// pingConn() sends a ping packet to c and waits for the matching pong
+// within KeepAliveTimeout. Any error or timeout means the connection is
+// considered dead.
+func (p *TcpConnPool) pingConn(c *tcpConn) error {
+	reqID := atomic.AddUint64(&c.nextReqID, 1)
+
+	pc := &pendingCall{
+		dataChan: make(chan []byte, 1),
+		errChan:  make(chan error, 1),
+	}
+
+	c.mu.Lock()
+	c.pending[reqID] = pc
+	c.mu.Unlock()
+
+	packet := &Packet{Command: pingCommand, RequestID: reqID}
+	data, err := json.Marshal(packet)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case c.writeChan <- data:
+	case <-c.dead:
+		return ErrConnectionClosed
+	}
+
+	select {
+	case resp := <-pc.dataChan:
+		if string(resp) != pongPayload {
+			return ErrConnectionClosed
+		}
+		return nil
+	case err := <-pc.errChan:
+		return err
+	case <-time.After(p.keepAliveTimeout):
+		c.mu.Lock()
+		delete(c.pending, reqID)
+		c.mu.Unlock()
+		return ErrConnectionTimeout
+	}
+}